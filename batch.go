@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// <---------------------- BatchWriter / Tx -------------------------------->
+
+// BatchWriter accumulates writes inside a Firestore.RunBatch call, mirroring
+// the Firestore SDK's WriteBatch.
+type BatchWriter interface {
+	Update(docPath string, data map[string]any) error
+	Set(docPath string, data map[string]any) error
+	Merge(docPath string, data map[string]any, mergePaths [][]string) error
+	Delete(docPath string) error
+}
+
+// Tx is passed to Firestore.RunTransaction. It extends BatchWriter with reads
+// that happen inside the same transaction, mirroring RunTransaction on
+// DocumentRef.
+type Tx interface {
+	BatchWriter
+	Get(docPath string) (map[string]any, error)
+}
+
+// maxBatchOps is Firestore's limit on operations per WriteBatch/transaction.
+const maxBatchOps = 500
+
+// <---------------------- ChangeBatch -------------------------------------->
+
+// ChangeBatch owns an ordered slice of Changes and commits them together
+// instead of one pushChange call at a time, so related documents can migrate
+// atomically.
+type ChangeBatch struct {
+	changes []*Change
+
+	// Transactional re-reads each Change's before inside the commit and
+	// aborts if it no longer matches what was captured (optimistic
+	// concurrency), instead of committing as a plain batch.
+	Transactional bool
+
+	// BatchSize caps operations per underlying commit; it defaults to
+	// maxBatchOps and is split across multiple batches above that.
+	BatchSize int
+}
+
+// NewChangeBatch builds a ChangeBatch over changes.
+func NewChangeBatch(changes []*Change) *ChangeBatch {
+	return &ChangeBatch{changes: changes, BatchSize: maxBatchOps}
+}
+
+// Commit pushes every Change in the batch, splitting into chunks of at most
+// BatchSize ops. Each chunk runs inside Firestore.RunTransaction when
+// Transactional is set, or Firestore.RunBatch otherwise. On failure the error
+// is wrapped with a compound rollback plan synthesized from only the chunks
+// that actually committed, in reverse commit order - changes in the failed
+// chunk and any chunk after it were never applied and must not be rolled back.
+func (cb *ChangeBatch) Commit(database Firestore) error {
+	size := cb.BatchSize
+	if size <= 0 {
+		size = maxBatchOps
+	}
+
+	for start := 0; start < len(cb.changes); start += size {
+		end := start + size
+		if end > len(cb.changes) {
+			end = len(cb.changes)
+		}
+		chunk := cb.changes[start:end]
+
+		var err error
+		if cb.Transactional {
+			err = database.RunTransaction(func(tx Tx) error {
+				return commitChunk(chunk, tx, database)
+			})
+		} else {
+			err = database.RunBatch(func(bw BatchWriter) error {
+				return commitChunk(chunk, bw, database)
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("committing batch [%d:%d]: %w\nrollback plan:\n%s", start, end, err, rollbackPlan(cb.changes[:start]))
+		}
+	}
+	return nil
+}
+
+// commitChunk writes one chunk of Changes through bw, routing each Change's
+// command the same way Change.pushChange does so a batched Change gets the
+// same deep-merge and sentinel-transform handling as a standalone push.
+// When bw is a Tx it first re-reads each docPath and aborts the chunk if the
+// document has drifted from the before captured when the Change was solved.
+func commitChunk(chunk []*Change, bw BatchWriter, database Firestore) error {
+	for _, c := range chunk {
+		if tx, ok := bw.(Tx); ok {
+			current, err := tx.Get(c.docPath)
+			if err != nil {
+				return err
+			}
+			if !sameData(current, c.before) {
+				return fmt.Errorf("document %q changed since before was captured, aborting transaction", c.docPath)
+			}
+		}
+
+		data := translateSentinels(c.patch, database)
+
+		var err error
+		switch c.command {
+		case MigratorUpdate:
+			err = bw.Update(c.docPath, data)
+		case MigratorMerge:
+			err = bw.Merge(c.docPath, data, c.mergePaths)
+		case MigratorSet, MigratorAdd:
+			err = bw.Set(c.docPath, data)
+		default:
+			err = bw.Delete(c.docPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackPlan synthesizes a compound rollback by concatenating committed's
+// rollback instructions in reverse commit order.
+func rollbackPlan(committed []*Change) string {
+	plan := make([]string, 0, len(committed))
+	for i := len(committed) - 1; i >= 0; i-- {
+		plan = append(plan, committed[i].rollback)
+	}
+	return strings.Join(plan, "\n")
+}
+
+// sameData reports whether a and b marshal to identical JSON.
+func sameData(a, b map[string]any) bool {
+	ab, errA := json.Marshal(a)
+	bb, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return string(ab) == string(bb)
+}
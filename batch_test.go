@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChangeBatchCommitPushesEveryChange(t *testing.T) {
+	db := newFakeFirestore()
+	db.docs["users/1"] = map[string]any{"name": "ada"}
+	db.docs["users/2"] = map[string]any{"name": "grace"}
+
+	c1 := NewChange("users/1", db.docs["users/1"], map[string]any{"name": "ADA"}, MigratorSet, "", db)
+	c1.after = map[string]any{"name": "ADA"}
+	c1.rollback = "rollback-1"
+	c2 := NewChange("users/2", db.docs["users/2"], map[string]any{"name": "GRACE"}, MigratorSet, "", db)
+	c2.after = map[string]any{"name": "GRACE"}
+	c2.rollback = "rollback-2"
+
+	batch := NewChangeBatch([]*Change{c1, c2})
+	if err := batch.Commit(db); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if db.docs["users/1"]["name"] != "ADA" || db.docs["users/2"]["name"] != "GRACE" {
+		t.Errorf("expected both documents to be written, got %v", db.docs)
+	}
+}
+
+func TestChangeBatchRollbackPlanOnlyCoversCommittedChunks(t *testing.T) {
+	db := newFakeFirestore()
+	for _, p := range []string{"users/1", "users/2", "users/3"} {
+		db.docs[p] = map[string]any{"name": "x"}
+	}
+
+	ok1 := NewChange("users/1", db.docs["users/1"], map[string]any{"name": "1"}, MigratorSet, "", db)
+	ok1.after, ok1.rollback = map[string]any{"name": "1"}, "rollback-ok1"
+
+	// users/2's captured before doesn't match what Get returns, so the
+	// transactional drift check fails and this chunk never commits.
+	bad := NewChange("users/2", map[string]any{"name": "stale-before"}, map[string]any{"name": "2"}, MigratorSet, "", db)
+	bad.after, bad.rollback = map[string]any{"name": "2"}, "rollback-bad"
+
+	neverRun := NewChange("users/3", db.docs["users/3"], map[string]any{"name": "3"}, MigratorSet, "", db)
+	neverRun.after, neverRun.rollback = map[string]any{"name": "3"}, "rollback-never-run"
+
+	batch := &ChangeBatch{changes: []*Change{ok1, bad, neverRun}, Transactional: true, BatchSize: 1}
+	err := batch.Commit(db)
+	if err == nil {
+		t.Fatal("expected Commit to fail on the drifted document")
+	}
+
+	if !strings.Contains(err.Error(), "rollback-ok1") {
+		t.Errorf("expected rollback plan to include the committed change, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "rollback-bad") || strings.Contains(err.Error(), "rollback-never-run") {
+		t.Errorf("rollback plan must not include uncommitted changes, got: %v", err)
+	}
+}
+
+func TestCommitChunkRoutesMergeAndTranslatesSentinels(t *testing.T) {
+	db := newFakeFirestore()
+	db.docs["users/1"] = map[string]any{"name": "ada", "stats": map[string]any{"views": int64(10)}}
+
+	merge := NewChange("users/1", db.docs["users/1"], map[string]any{"stats": map[string]any{"views": Increment(5)}}, MigratorMerge, "", db)
+	merge.mergePaths = [][]string{{"stats", "views"}}
+
+	if err := commitChunk([]*Change{merge}, db, db); err != nil {
+		t.Fatalf("commitChunk: %v", err)
+	}
+
+	if len(db.encoded) != 1 {
+		t.Errorf("expected the nested Increment to go through EncodeSentinel, got %d calls", len(db.encoded))
+	}
+	if db.docs["users/1"]["name"] != "ada" {
+		t.Errorf("MigratorMerge in a batch must not overwrite untouched fields, got %v", db.docs["users/1"])
+	}
+}
@@ -18,6 +18,7 @@ const (
 	MigratorSet
 	MigratorAdd
 	MigratorDelete
+	MigratorMerge
 )
 
 // Change represents one change on one document. A change must contain enough data points to be solved.
@@ -34,6 +35,18 @@ type Change struct {
 	errState    error
 	database    Firestore
 	cache       map[string]map[string]any
+
+	// mergePaths restricts a MigratorMerge Change to only these field paths.
+	// When nil, every key patch sets is merged (firestore.MergeAll); when
+	// set, only the listed paths are touched (firestore.Merge(fieldPaths...)).
+	mergePaths [][]string
+}
+
+// WithMergePaths restricts a MigratorMerge Change to only the given field
+// paths instead of merging every key patch sets.
+func (c *Change) WithMergePaths(paths [][]string) *Change {
+	c.mergePaths = paths
+	return c
 }
 
 // NewChange is a Change factory.
@@ -95,6 +108,8 @@ func (c *Change) commandString() string {
 		return "add"
 	case MigratorDelete:
 		return "delete"
+	case MigratorMerge:
+		return "merge"
 	default:
 		return "unknown"
 	}
@@ -106,14 +121,17 @@ func (c *Change) inferAfter() error {
 	if c.command != MigratorUnknown {
 		switch c.command {
 		case MigratorSet:
-			c.after = c.patch
+			c.after = resolvePatchSentinels(c.patch, c.before)
 			return nil
 		case MigratorAdd:
-			c.after = c.patch
+			c.after = resolvePatchSentinels(c.patch, c.before)
 			return nil
 		case MigratorDelete:
 			c.after = map[string]any{}
 			return nil
+		case MigratorMerge:
+			c.after = mergePatch(c.before, c.patch, c.mergePaths)
+			return nil
 		}
 
 	}
@@ -121,6 +139,11 @@ func (c *Change) inferAfter() error {
 		return errors.New("Need before and patch/instruction to infer after.")
 	}
 
+	if hasSentinel(c.patch) {
+		c.after = applySentinels(c.before, c.patch)
+		return nil
+	}
+
 	sBefore := c.fetchCache("sBefore", c.before)
 	sPatch := c.fetchCache("sPatch", c.patch)
 	bm, err := json.Marshal(sBefore)
@@ -176,7 +199,7 @@ func (c *Change) inferRollback() error {
 	if c.before == nil || c.after == nil {
 		return errors.New("Need before and after value to infer rollback.")
 	}
-	sBefore, sAfter := c.beforeAfterCache()
+	sBefore, sAfter := c.diffScopeCache()
 	a, err := json.Marshal(sAfter)
 	if err != nil {
 		return err
@@ -211,7 +234,7 @@ func (c *Change) inferPrettyDiff() error {
 		return errors.New("Need before and after value to infer pretty diff.")
 	}
 
-	sBefore, sAfter := c.beforeAfterCache()
+	sBefore, sAfter := c.diffScopeCache()
 	s, err := PrettyDiff(sBefore, sAfter)
 	if err != nil {
 		return err
@@ -235,15 +258,7 @@ func (c *Change) Present() ([]string, string) {
 		out += fmt.Sprintf("< no changes >\n")
 
 	} else {
-		replace := []string{"__timestamp__", "__delete__", "__docref__"}
-		s := c.prettyDiff
-
-		for _, r := range replace {
-			s = strings.Replace(s, `"`+r, "", -1)
-			s = strings.Replace(s, r+`"`, "", -1)
-		}
-
-		out += fmt.Sprintf(s + "\n")
+		out += fmt.Sprintf(c.prettyDiff + "\n")
 	}
 	return header, out
 
@@ -251,7 +266,7 @@ func (c *Change) Present() ([]string, string) {
 
 // pushChange executes this change unit against the database.
 func (c *Change) pushChange(transformer func(map[string]any) map[string]any) error {
-	data := transformer(c.patch)
+	data := translateSentinels(transformer(c.patch), c.database)
 	switch c.command {
 	case MigratorUpdate:
 		return c.database.UpdateDoc(c.docPath, data)
@@ -259,6 +274,8 @@ func (c *Change) pushChange(transformer func(map[string]any) map[string]any) err
 		return c.database.SetDoc(c.docPath, data)
 	case MigratorAdd:
 		return c.database.SetDoc(c.docPath, data)
+	case MigratorMerge:
+		return c.database.MergeDoc(c.docPath, data, c.mergePaths)
 	default:
 		return c.database.DeleteDoc(c.docPath)
 	}
@@ -276,3 +293,15 @@ func (c *Change) beforeAfterCache() (map[string]any, map[string]any) {
 	// var sBefore, sAfter string
 	return c.fetchCache("serialBefore", c.before), c.fetchCache("serialAfter", c.after)
 }
+
+// diffScopeCache returns the before/after pair that the rollback and pretty
+// diff should be computed over. A MigratorMerge only touches the subtree its
+// patch (or mergePaths) names, so it's scoped down to that subtree instead of
+// the whole document; every other command diffs the whole before/after.
+func (c *Change) diffScopeCache() (map[string]any, map[string]any) {
+	if c.command != MigratorMerge {
+		return c.beforeAfterCache()
+	}
+	scopedBefore, scopedAfter := c.mergeScope()
+	return c.fetchCache("mergeBefore", scopedBefore), c.fetchCache("mergeAfter", scopedAfter)
+}
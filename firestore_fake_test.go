@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// fakeFirestore is an in-memory Firestore used only by tests - just enough
+// to exercise ChangeGroup, ChangeBatch and the journal without a real
+// Firestore project. It also implements BatchWriter/Tx directly, since
+// RunBatch/RunTransaction just hand the fake itself to the callback.
+type fakeFirestore struct {
+	docs    map[string]map[string]any
+	encoded []Sentinel
+}
+
+func newFakeFirestore() *fakeFirestore {
+	return &fakeFirestore{docs: map[string]map[string]any{}}
+}
+
+func (f *fakeFirestore) GetDoc(docPath string) (map[string]any, error) {
+	d, ok := f.docs[docPath]
+	if !ok {
+		return nil, fmt.Errorf("no such document: %q", docPath)
+	}
+	return deepCopyMap(d), nil
+}
+
+func (f *fakeFirestore) SetDoc(docPath string, data map[string]any) error {
+	f.docs[docPath] = deepCopyMap(data)
+	return nil
+}
+
+func (f *fakeFirestore) UpdateDoc(docPath string, data map[string]any) error {
+	merged := deepCopyMap(f.docs[docPath])
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+	f.docs[docPath] = merged
+	return nil
+}
+
+func (f *fakeFirestore) DeleteDoc(docPath string) error {
+	delete(f.docs, docPath)
+	return nil
+}
+
+func (f *fakeFirestore) MergeDoc(docPath string, data map[string]any, paths [][]string) error {
+	f.docs[docPath] = mergePatch(f.docs[docPath], data, paths)
+	return nil
+}
+
+func (f *fakeFirestore) QueryDocs(re *regexp.Regexp) (map[string]map[string]any, error) {
+	out := map[string]map[string]any{}
+	for path, data := range f.docs {
+		if re.MatchString(path) {
+			out[path] = deepCopyMap(data)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeFirestore) EncodeSentinel(s Sentinel) any {
+	f.encoded = append(f.encoded, s)
+	return serializeSentinel(s)
+}
+
+func (f *fakeFirestore) RunBatch(fn func(BatchWriter) error) error {
+	return fn(f)
+}
+
+func (f *fakeFirestore) RunTransaction(fn func(Tx) error) error {
+	return fn(f)
+}
+
+func (f *fakeFirestore) Update(docPath string, data map[string]any) error {
+	return f.UpdateDoc(docPath, data)
+}
+func (f *fakeFirestore) Set(docPath string, data map[string]any) error {
+	return f.SetDoc(docPath, data)
+}
+func (f *fakeFirestore) Merge(docPath string, data map[string]any, paths [][]string) error {
+	return f.MergeDoc(docPath, data, paths)
+}
+func (f *fakeFirestore) Delete(docPath string) error                { return f.DeleteDoc(docPath) }
+func (f *fakeFirestore) Get(docPath string) (map[string]any, error) { return f.GetDoc(docPath) }
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// <---------------------- JournalEntry / JournalSink ----------------------->
+
+// JournalEntry is everything needed to replay or roll back a single solved
+// Change after the process that ran it has exited.
+type JournalEntry struct {
+	DocPath    string         `json:"docPath"`
+	Command    Command        `json:"command"`
+	Before     map[string]any `json:"before"`
+	Patch      map[string]any `json:"patch"`
+	After      map[string]any `json:"after"`
+	Rollback   string         `json:"rollback"`
+	Timestamp  time.Time      `json:"timestamp"`
+	BeforeHash string         `json:"beforeHash"`
+	Committed  bool           `json:"committed"`
+}
+
+// JournalSink is where journal entries are streamed before and after each
+// Change is pushed. FileJournal and FirestoreJournal are the sinks GoFig
+// ships; only FileJournal can back ReplayJournal, since
+// FirestoreJournal.Entries always returns an error.
+type JournalSink interface {
+	Append(entry JournalEntry) error
+	MarkCommitted(docPath string, timestamp time.Time) error
+	Entries() ([]JournalEntry, error)
+}
+
+// <---------------------- FileJournal --------------------------------------->
+
+// FileJournal is a JournalSink backed by a newline-delimited JSON file.
+type FileJournal struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileJournal opens a FileJournal at path, creating it on first Append.
+func NewFileJournal(path string) *FileJournal {
+	return &FileJournal{path: path}
+}
+
+// Append streams entry to the journal file as one more line.
+func (j *FileJournal) Append(entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// MarkCommitted flags the entry for docPath/timestamp as committed. The read
+// and the rewrite happen under a single lock hold so an Append landing
+// between them can't be clobbered by the rewrite.
+func (j *FileJournal) MarkCommitted(docPath string, timestamp time.Time) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.readEntries()
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		if entries[i].DocPath == docPath && entries[i].Timestamp.Equal(timestamp) {
+			entries[i].Committed = true
+		}
+	}
+	return j.rewrite(entries)
+}
+
+// Entries reads back every entry recorded so far, in append order.
+func (j *FileJournal) Entries() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.readEntries()
+}
+
+// readEntries reads back every entry recorded so far, in append order.
+// Callers must hold j.mu.
+func (j *FileJournal) readEntries() ([]JournalEntry, error) {
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []JournalEntry
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// rewrite overwrites the journal file with entries. Callers must hold j.mu.
+func (j *FileJournal) rewrite(entries []JournalEntry) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return os.WriteFile(j.path, buf.Bytes(), 0644)
+}
+
+// <---------------------- FirestoreJournal ----------------------------------->
+
+// FirestoreJournal is a JournalSink backed by documents under a configurable
+// Firestore collection, defaulting to "_migrations".
+type FirestoreJournal struct {
+	database   Firestore
+	collection string
+}
+
+// NewFirestoreJournal builds a FirestoreJournal writing under collection,
+// defaulting to "_migrations" when collection is empty.
+func NewFirestoreJournal(database Firestore, collection string) *FirestoreJournal {
+	if collection == "" {
+		collection = "_migrations"
+	}
+	return &FirestoreJournal{database: database, collection: collection}
+}
+
+func (j *FirestoreJournal) entryPath(docPath string, timestamp time.Time) string {
+	safePath := strings.NewReplacer("/", "_").Replace(docPath)
+	return fmt.Sprintf("%s/%s_%d", j.collection, safePath, timestamp.UnixNano())
+}
+
+// Append writes entry as a new document under j.collection.
+func (j *FirestoreJournal) Append(entry JournalEntry) error {
+	data, err := journalEntryToMap(entry)
+	if err != nil {
+		return err
+	}
+	return j.database.SetDoc(j.entryPath(entry.DocPath, entry.Timestamp), data)
+}
+
+// MarkCommitted flips the committed field on the journal document for
+// docPath/timestamp.
+func (j *FirestoreJournal) MarkCommitted(docPath string, timestamp time.Time) error {
+	return j.database.UpdateDoc(j.entryPath(docPath, timestamp), map[string]any{"committed": true})
+}
+
+// Entries is not implemented for FirestoreJournal: it reads nothing back and
+// always returns an error. Use FileJournal when ReplayJournal support is
+// needed.
+func (j *FirestoreJournal) Entries() ([]JournalEntry, error) {
+	return nil, errors.New("FirestoreJournal.Entries is not implemented; replay requires a collection-listing Firestore method")
+}
+
+func journalEntryToMap(entry JournalEntry) (map[string]any, error) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// <---------------------- journaling + replay -------------------------------->
+
+// hashBefore returns a content hash of a document's data, used both to
+// record what a Change started from and to detect drift before replaying a
+// rollback.
+func hashBefore(data map[string]any) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// journalAndPush records c as a JournalEntry in sink before pushing it, then
+// marks the entry committed once pushChange succeeds, so a crash mid-run
+// leaves an accurate record of what was and wasn't applied.
+func journalAndPush(c *Change, sink JournalSink, transformer func(map[string]any) map[string]any) error {
+	h, err := hashBefore(c.before)
+	if err != nil {
+		return err
+	}
+
+	ts := time.Now()
+	entry := JournalEntry{
+		DocPath:    c.docPath,
+		Command:    c.command,
+		Before:     c.before,
+		Patch:      tagSentinels(c.patch),
+		After:      c.after,
+		Rollback:   c.rollback,
+		Timestamp:  ts,
+		BeforeHash: h,
+	}
+	if err := sink.Append(entry); err != nil {
+		return fmt.Errorf("journaling change for %q: %w", c.docPath, err)
+	}
+
+	if err := c.pushChange(transformer); err != nil {
+		return err
+	}
+
+	return sink.MarkCommitted(c.docPath, ts)
+}
+
+// ReplayMode selects what ReplayJournal does with the entries it reads back.
+type ReplayMode int
+
+const (
+	// ReplayForward re-applies every uncommitted entry, resuming a run that
+	// crashed partway through.
+	ReplayForward ReplayMode = iota
+	// ReplayRollback unwinds the whole run by feeding each committed entry's
+	// rollback instruction to a fresh Change, most recent entry first.
+	ReplayRollback
+)
+
+// ReplayJournal reconstructs Changes from sink and either resumes the run
+// forward by re-applying every uncommitted entry, or rolls the whole run back.
+// A rollback refuses to touch any document whose current state no longer
+// hashes to the entry's recorded after, since that means something else
+// has touched it since the run committed.
+func ReplayJournal(sink JournalSink, mode ReplayMode, database Firestore) error {
+	entries, err := sink.Entries()
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case ReplayForward:
+		return replayForward(entries, sink, database)
+	case ReplayRollback:
+		return replayRollback(entries, database)
+	default:
+		return fmt.Errorf("unknown replay mode %v", mode)
+	}
+}
+
+// replayForward re-applies every uncommitted entry and marks that same
+// entry (by its original docPath/timestamp) committed once the push
+// succeeds - it must not journalAndPush, which would append a brand new
+// entry under a fresh timestamp and leave the original entry permanently
+// uncommitted, causing every later replay to redo (and re-append) the work.
+func replayForward(entries []JournalEntry, sink JournalSink, database Firestore) error {
+	for _, e := range entries {
+		if e.Committed {
+			continue
+		}
+		c := NewChange(e.DocPath, e.Before, untagSentinels(e.Patch), e.Command, "", database)
+		if err := c.SolveChange(); err != nil {
+			return fmt.Errorf("resuming %q: %w", e.DocPath, err)
+		}
+		if err := c.pushChange(func(d map[string]any) map[string]any { return d }); err != nil {
+			return fmt.Errorf("resuming %q: %w", e.DocPath, err)
+		}
+		if err := sink.MarkCommitted(e.DocPath, e.Timestamp); err != nil {
+			return fmt.Errorf("marking %q committed after resume: %w", e.DocPath, err)
+		}
+	}
+	return nil
+}
+
+func replayRollback(entries []JournalEntry, database Firestore) error {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !e.Committed {
+			continue
+		}
+
+		current, err := database.GetDoc(e.DocPath)
+		if err != nil {
+			return fmt.Errorf("reading current state of %q before rollback: %w", e.DocPath, err)
+		}
+		currentHash, err := hashBefore(current)
+		if err != nil {
+			return err
+		}
+		afterHash, err := hashBefore(e.After)
+		if err != nil {
+			return err
+		}
+		if currentHash != afterHash {
+			return fmt.Errorf("refusing to roll back %q: current state no longer matches the recorded after", e.DocPath)
+		}
+
+		c := NewChange(e.DocPath, e.After, nil, MigratorUpdate, e.Rollback, database)
+		if err := c.SolveChange(); err != nil {
+			return fmt.Errorf("rolling back %q: %w", e.DocPath, err)
+		}
+		if err := c.pushChange(func(d map[string]any) map[string]any { return d }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileJournalAppendEntriesMarkCommitted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.ndjson")
+	j := NewFileJournal(path)
+
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := j.Append(JournalEntry{DocPath: "users/1", Command: MigratorSet, Timestamp: ts}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.MarkCommitted("users/1", ts); err != nil {
+		t.Fatalf("MarkCommitted: %v", err)
+	}
+
+	entries, err := j.Entries()
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 1 || !entries[0].Committed {
+		t.Fatalf("expected 1 committed entry, got %+v", entries)
+	}
+}
+
+func TestFileJournalMarkCommittedPreservesOtherEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.ndjson")
+	j := NewFileJournal(path)
+
+	ts1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts2 := ts1.Add(time.Second)
+	if err := j.Append(JournalEntry{DocPath: "users/1", Timestamp: ts1}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.Append(JournalEntry{DocPath: "users/2", Timestamp: ts2}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.MarkCommitted("users/1", ts1); err != nil {
+		t.Fatalf("MarkCommitted: %v", err)
+	}
+
+	entries, err := j.Entries()
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected both entries to survive a MarkCommitted on one of them, got %+v", entries)
+	}
+}
+
+func TestReplayForwardMarksOriginalEntryCommitted(t *testing.T) {
+	db := newFakeFirestore()
+	db.docs["users/1"] = map[string]any{"name": "ada"}
+
+	path := filepath.Join(t.TempDir(), "journal.ndjson")
+	sink := NewFileJournal(path)
+
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := JournalEntry{
+		DocPath:   "users/1",
+		Command:   MigratorSet,
+		Before:    map[string]any{"name": "ada"},
+		Patch:     map[string]any{"name": "ADA"},
+		Timestamp: ts,
+	}
+	if err := sink.Append(entry); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	if err := ReplayJournal(sink, ReplayForward, db); err != nil {
+		t.Fatalf("first replay: %v", err)
+	}
+	if err := ReplayJournal(sink, ReplayForward, db); err != nil {
+		t.Fatalf("second replay: %v", err)
+	}
+
+	entries, err := sink.Entries()
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected a second replay to be a no-op, not append a new entry; got %d entries", len(entries))
+	}
+	if !entries[0].Committed {
+		t.Errorf("expected the original entry to be marked committed")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+// <---------------------- merge helpers ------------------------------------>
+
+// mergePatch deep-merges patch into before, mirroring
+// firestore.Set(..., firestore.MergeAll). When paths is non-nil, only those
+// field paths are copied from patch, mirroring
+// firestore.Set(..., firestore.Merge(fieldPaths...)); every other key in
+// before is left untouched either way. A Sentinel value in patch is, like
+// MigratorSet/MigratorAdd, resolved against its current value in after
+// rather than copied in literally.
+func mergePatch(before, patch map[string]any, paths [][]string) map[string]any {
+	after := deepCopyMap(before)
+	if len(paths) == 0 {
+		deepMerge(after, patch)
+		return after
+	}
+	for _, p := range paths {
+		v, ok := lookupPath(patch, p)
+		if !ok {
+			continue
+		}
+		if s, ok := v.(Sentinel); ok {
+			if _, isDelete := s.(fieldDeleteSentinel); isDelete {
+				deletePath(after, p)
+				continue
+			}
+			current, _ := lookupPath(after, p)
+			setPath(after, p, s.apply(current))
+			continue
+		}
+		setPath(after, p, v)
+	}
+	return after
+}
+
+// mergeScope returns before/after restricted to only the field paths a
+// MigratorMerge actually touched (c.mergePaths, or patch's top-level keys
+// when mergePaths is nil), so the presented diff and rollback aren't
+// polluted by fields the merge left unchanged.
+func (c *Change) mergeScope() (before, after map[string]any) {
+	paths := c.mergePaths
+	if len(paths) == 0 {
+		paths = make([][]string, 0, len(c.patch))
+		for k := range c.patch {
+			paths = append(paths, []string{k})
+		}
+	}
+
+	before, after = map[string]any{}, map[string]any{}
+	for _, p := range paths {
+		if v, ok := lookupPath(c.before, p); ok {
+			setPath(before, p, v)
+		}
+		if v, ok := lookupPath(c.after, p); ok {
+			setPath(after, p, v)
+		}
+	}
+	return before, after
+}
+
+// deepCopyMap returns a copy of m, recursing into nested maps so mutating the
+// result never aliases m.
+func deepCopyMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		if nested, ok := v.(map[string]any); ok {
+			out[k] = deepCopyMap(nested)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// deepMerge merges src into dst in place, recursing when both sides hold a
+// map at the same key and overwriting otherwise. A Sentinel value in src is
+// resolved against dst's current value at that key instead of being copied
+// in literally, the same as MigratorSet/MigratorAdd's resolvePatchSentinels.
+func deepMerge(dst, src map[string]any) {
+	for k, v := range src {
+		if s, ok := v.(Sentinel); ok {
+			if _, isDelete := s.(fieldDeleteSentinel); isDelete {
+				delete(dst, k)
+				continue
+			}
+			dst[k] = s.apply(dst[k])
+			continue
+		}
+		nestedSrc, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		if nestedDst, ok := dst[k].(map[string]any); ok {
+			deepMerge(nestedDst, nestedSrc)
+			continue
+		}
+		dst[k] = deepCopyMap(nestedSrc)
+	}
+}
+
+// lookupPath walks m along path, returning ok=false if any segment is
+// missing or not itself a map.
+func lookupPath(m map[string]any, path []string) (any, bool) {
+	cur := any(m)
+	for _, seg := range path {
+		cm, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		cur, ok = cm[seg]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// setPath writes value into m at path, creating intermediate maps as needed.
+func setPath(m map[string]any, path []string, value any) {
+	cur := m
+	for i, seg := range path {
+		if i == len(path)-1 {
+			cur[seg] = value
+			return
+		}
+		next, ok := cur[seg].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			cur[seg] = next
+		}
+		cur = next
+	}
+}
+
+// deletePath removes the field at path from m, if present.
+func deletePath(m map[string]any, path []string) {
+	cur := m
+	for i, seg := range path {
+		if i == len(path)-1 {
+			delete(cur, seg)
+			return
+		}
+		next, ok := cur[seg].(map[string]any)
+		if !ok {
+			return
+		}
+		cur = next
+	}
+}
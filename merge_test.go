@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestMergePatchMergeAll(t *testing.T) {
+	before := map[string]any{"name": "ada", "stats": map[string]any{"views": 1, "likes": 2}}
+	patch := map[string]any{"stats": map[string]any{"views": 5}}
+
+	after := mergePatch(before, patch, nil)
+
+	stats := after["stats"].(map[string]any)
+	if stats["views"] != 5 {
+		t.Errorf("expected views to be overwritten, got %v", stats["views"])
+	}
+	if stats["likes"] != 2 {
+		t.Errorf("expected untouched nested field to survive merge, got %v", stats["likes"])
+	}
+	if after["name"] != "ada" {
+		t.Errorf("expected untouched top-level field to survive merge, got %v", after["name"])
+	}
+	// before must not be mutated by the merge.
+	if before["stats"].(map[string]any)["views"] != 1 {
+		t.Errorf("mergePatch mutated its before argument")
+	}
+}
+
+func TestMergePatchFieldPaths(t *testing.T) {
+	before := map[string]any{"name": "ada", "stats": map[string]any{"views": 1, "likes": 2}}
+	patch := map[string]any{"name": "ignored", "stats": map[string]any{"views": 5}}
+
+	after := mergePatch(before, patch, [][]string{{"stats", "views"}})
+
+	if after["name"] != "ada" {
+		t.Errorf("expected mergePaths to restrict the merge to stats.views, but name changed to %v", after["name"])
+	}
+	stats := after["stats"].(map[string]any)
+	if stats["views"] != 5 {
+		t.Errorf("expected stats.views to be merged, got %v", stats["views"])
+	}
+}
+
+func TestMergePatchResolvesSentinels(t *testing.T) {
+	before := map[string]any{"stats": map[string]any{"views": int64(10)}}
+	patch := map[string]any{"stats": map[string]any{"views": Increment(5)}}
+
+	after := mergePatch(before, patch, nil)
+
+	stats := after["stats"].(map[string]any)
+	if stats["views"] != int64(15) {
+		t.Errorf("expected Increment(5) against int64(10) to resolve to int64(15), got %v (%T)", stats["views"], stats["views"])
+	}
+}
+
+func TestMergePatchFieldDelete(t *testing.T) {
+	before := map[string]any{"name": "ada", "legacy": "x"}
+	patch := map[string]any{"legacy": FieldDelete}
+
+	after := mergePatch(before, patch, [][]string{{"legacy"}})
+
+	if _, present := after["legacy"]; present {
+		t.Errorf("expected FieldDelete to remove legacy, got %v", after["legacy"])
+	}
+	if after["name"] != "ada" {
+		t.Errorf("expected untouched field to survive, got %v", after["name"])
+	}
+}
+
+func TestMergeScopeRestrictsToTouchedSubtree(t *testing.T) {
+	c := &Change{
+		before:     map[string]any{"name": "ada", "stats": map[string]any{"views": 1, "likes": 2}},
+		after:      map[string]any{"name": "ada", "stats": map[string]any{"views": 5, "likes": 2}},
+		patch:      map[string]any{"stats": map[string]any{"views": 5}},
+		mergePaths: [][]string{{"stats", "views"}},
+	}
+
+	before, after := c.mergeScope()
+
+	if _, present := before["name"]; present {
+		t.Errorf("expected mergeScope to exclude untouched top-level fields, got %v", before)
+	}
+	beforeStats := before["stats"].(map[string]any)
+	afterStats := after["stats"].(map[string]any)
+	if beforeStats["views"] != 1 || afterStats["views"] != 5 {
+		t.Errorf("expected scoped before/after to reflect only stats.views, got before=%v after=%v", beforeStats, afterStats)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// <---------------------- docPath patterns ------------------------------>
+
+// patternPrefix is the required opt-in sigil marking a docPath as a pattern
+// to expand against the database, rather than a literal document reference.
+// Firestore document IDs may legally contain glob/regex metacharacters
+// ('*', '^', '(', etc.), so a pattern can't be told apart from a literal
+// docPath by content alone - the caller must say so explicitly.
+const patternPrefix = "pattern:"
+
+// regexMetaChars are the characters that mark a pattern (after patternPrefix
+// is stripped) as a hand-written regex rather than a glob.
+const regexMetaChars = "^$()|+\\"
+
+// isDocPathPattern reports whether docPath should be expanded against the
+// database rather than treated as a literal document reference.
+func isDocPathPattern(docPath string) bool {
+	return strings.HasPrefix(docPath, patternPrefix)
+}
+
+// compileDocPathPattern strips patternPrefix from docPath and turns the
+// remainder into a regexp matching every concrete document path it targets.
+// Two styles are supported:
+//   - glob, e.g. "pattern:users/*/orders/**" ('*' matches one path segment,
+//     '**' matches any number of segments)
+//   - regex, e.g. "pattern:^users/[^/]+/orders/.*$" - any pattern containing
+//     a regex metacharacter is compiled as-is instead of glob-translated
+func compileDocPathPattern(docPath string) (*regexp.Regexp, error) {
+	pattern := strings.TrimPrefix(docPath, patternPrefix)
+
+	if strings.ContainsAny(pattern, regexMetaChars) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid docPath regex %q: %w", docPath, err)
+		}
+		return re, nil
+	}
+
+	re, err := regexp.Compile(globToRegex(pattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid docPath glob %q: %w", docPath, err)
+	}
+	return re, nil
+}
+
+// globToRegex translates a docPath glob into the equivalent regex source.
+func globToRegex(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case glob[i] == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// <---------------------- ChangeGroup ------------------------------------>
+
+// ChangeGroup is a docPath pattern expanded into one Change per matching
+// document, so a single migration can fan out across a whole collection
+// instead of requiring the caller to enumerate paths by hand.
+type ChangeGroup struct {
+	pattern string
+	changes []*Change
+}
+
+// NewChangeGroup expands docPath into a ChangeGroup. Any docPath is treated
+// as a literal document reference resolving to a single Change, unless it
+// carries the patternPrefix opt-in sigil ("pattern:"), in which case the
+// glob or regex after the prefix is matched against database to discover
+// every document it currently targets, each becoming its own Change with
+// its own before/after/rollback.
+func NewChangeGroup(docPath string,
+	patch map[string]any,
+	command Command,
+	instruction string,
+	database Firestore) (*ChangeGroup, error) {
+
+	if !isDocPathPattern(docPath) {
+		before, err := database.GetDoc(docPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", docPath, err)
+		}
+		c := NewChange(docPath, before, patch, command, instruction, database)
+		return &ChangeGroup{pattern: docPath, changes: []*Change{c}}, nil
+	}
+
+	re, err := compileDocPathPattern(docPath)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := database.QueryDocs(re)
+	if err != nil {
+		return nil, fmt.Errorf("expanding docPath pattern %q: %w", docPath, err)
+	}
+
+	g := &ChangeGroup{pattern: docPath}
+	for path, before := range matches {
+		g.changes = append(g.changes, NewChange(path, before, patch, command, instruction, database))
+	}
+	return g, nil
+}
+
+// SolveChanges solves every Change in the group independently. A Change that
+// fails to solve keeps its errState instead of aborting the rest of the
+// group, so a handful of bad documents don't block the whole migration.
+func (g *ChangeGroup) SolveChanges() {
+	for _, c := range g.changes {
+		c.SolveChange()
+	}
+}
+
+// Present aggregates every member Change's pretty diff under a single header
+// for the pattern that produced them.
+func (g *ChangeGroup) Present() ([]string, string) {
+	header := []string{"Target: " + clrTheme().blue(g.pattern), fmt.Sprintf(" >> [%d docs]", len(g.changes)) + "\n\n"}
+
+	out := ""
+	for _, c := range g.changes {
+		_, body := c.Present()
+		out += fmt.Sprintf("-- %s --\n", c.docPath)
+		out += body
+	}
+	return header, out
+}
+
+// pushChange pushes every member Change, skipping any already in an error
+// state, and returns the first error encountered while still attempting the
+// remaining documents.
+func (g *ChangeGroup) pushChange(transformer func(map[string]any) map[string]any) error {
+	var firstErr error
+	for _, c := range g.changes {
+		if c.errState != nil {
+			continue
+		}
+		if err := c.pushChange(transformer); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
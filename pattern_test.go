@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+func TestIsDocPathPattern(t *testing.T) {
+	cases := []struct {
+		docPath string
+		want    bool
+	}{
+		{"users/123", false},
+		{"users/foo+bar@example.com", false}, // legal Firestore doc ID, must stay literal
+		{"users/(legacy)", false},
+		{"pattern:users/*/orders/**", true},
+		{"pattern:^users/[^/]+/orders/.*$", true},
+	}
+	for _, c := range cases {
+		if got := isDocPathPattern(c.docPath); got != c.want {
+			t.Errorf("isDocPathPattern(%q) = %v, want %v", c.docPath, got, c.want)
+		}
+	}
+}
+
+func TestCompileDocPathPatternGlob(t *testing.T) {
+	re, err := compileDocPathPattern("pattern:users/*/orders/**")
+	if err != nil {
+		t.Fatalf("compileDocPathPattern: %v", err)
+	}
+	if !re.MatchString("users/42/orders/2024/01") {
+		t.Errorf("expected glob to match a nested orders path")
+	}
+	if re.MatchString("users/42/profile") {
+		t.Errorf("expected glob not to match a non-orders path")
+	}
+}
+
+func TestCompileDocPathPatternRegex(t *testing.T) {
+	re, err := compileDocPathPattern("pattern:^users/[^/]+/orders/.*$")
+	if err != nil {
+		t.Fatalf("compileDocPathPattern: %v", err)
+	}
+	if !re.MatchString("users/42/orders/99") {
+		t.Errorf("expected regex to match")
+	}
+	if re.MatchString("users/42/43/orders/99") {
+		t.Errorf("expected regex not to match a nested user segment")
+	}
+}
+
+func TestNewChangeGroupLiteralFetchesBefore(t *testing.T) {
+	db := newFakeFirestore()
+	db.docs["users/42"] = map[string]any{"name": "ada"}
+
+	g, err := NewChangeGroup("users/42", map[string]any{"name": "grace"}, MigratorSet, "", db)
+	if err != nil {
+		t.Fatalf("NewChangeGroup: %v", err)
+	}
+	if len(g.changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(g.changes))
+	}
+	if got := g.changes[0].before["name"]; got != "ada" {
+		t.Errorf("expected before to be fetched from the database, got %v", got)
+	}
+}
+
+func TestNewChangeGroupPatternExpandsMatches(t *testing.T) {
+	db := newFakeFirestore()
+	db.docs["users/1/orders/a"] = map[string]any{"status": "open"}
+	db.docs["users/2/orders/b"] = map[string]any{"status": "open"}
+	db.docs["users/1/profile"] = map[string]any{"name": "ada"}
+
+	g, err := NewChangeGroup("pattern:users/*/orders/*", map[string]any{"status": "closed"}, MigratorSet, "", db)
+	if err != nil {
+		t.Fatalf("NewChangeGroup: %v", err)
+	}
+	if len(g.changes) != 2 {
+		t.Fatalf("expected 2 matching changes, got %d", len(g.changes))
+	}
+}
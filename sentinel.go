@@ -0,0 +1,270 @@
+package main
+
+import "fmt"
+
+// <---------------------- Sentinel ---------------------------------------->
+
+// Sentinel is a typed stand-in for a Firestore field transform
+// (ServerTimestamp, ArrayUnion, ArrayRemove, Increment, Delete), analogous to
+// the values DocumentRef.Set/Update accept from the Firestore Go client.
+// inferAfter applies a Sentinel semantically against before so the computed
+// after and prettyDiff reflect the real post-write document, and pushChange
+// translates it into the driver's transform op instead of writing it as a
+// literal value.
+type Sentinel interface {
+	// tag identifies the sentinel kind as it round-trips through the journal
+	// as JSON, e.g. {"__sentinel__":"increment","value":1}.
+	tag() string
+	// apply computes the resulting field value given its current value.
+	apply(current any) any
+}
+
+const sentinelTagKey = "__sentinel__"
+const sentinelValueKey = "value"
+
+// ServerTimestampSentinel mirrors firestore.ServerTimestamp.
+type ServerTimestampSentinel struct{}
+
+func (ServerTimestampSentinel) tag() string { return "serverTimestamp" }
+func (ServerTimestampSentinel) apply(any) any {
+	return map[string]any{sentinelTagKey: "serverTimestamp"}
+}
+
+// ArrayUnionSentinel mirrors firestore.ArrayUnion: it set-unions its values
+// into whatever slice already sits at that field.
+type ArrayUnionSentinel []any
+
+func (ArrayUnionSentinel) tag() string { return "arrayUnion" }
+
+func (s ArrayUnionSentinel) apply(current any) any {
+	existing, _ := current.([]any)
+	seen := make(map[string]bool, len(existing))
+	out := append([]any{}, existing...)
+	for _, v := range existing {
+		seen[fmt.Sprint(v)] = true
+	}
+	for _, v := range s {
+		key := fmt.Sprint(v)
+		if !seen[key] {
+			out = append(out, v)
+			seen[key] = true
+		}
+	}
+	return out
+}
+
+// ArrayRemoveSentinel mirrors firestore.ArrayRemove: it drops any of its
+// values out of whatever slice already sits at that field.
+type ArrayRemoveSentinel []any
+
+func (ArrayRemoveSentinel) tag() string { return "arrayRemove" }
+
+func (s ArrayRemoveSentinel) apply(current any) any {
+	existing, _ := current.([]any)
+	drop := make(map[string]bool, len(s))
+	for _, v := range s {
+		drop[fmt.Sprint(v)] = true
+	}
+	out := []any{}
+	for _, v := range existing {
+		if !drop[fmt.Sprint(v)] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// IncrementSentinel mirrors firestore.Increment: it adds N to whatever
+// numeric value already sits at that field.
+type IncrementSentinel struct{ N float64 }
+
+// Increment builds an IncrementSentinel, matching firestore.Increment's
+// calling convention.
+func Increment(n float64) IncrementSentinel { return IncrementSentinel{N: n} }
+
+func (IncrementSentinel) tag() string { return "increment" }
+
+func (s IncrementSentinel) apply(current any) any {
+	switch v := current.(type) {
+	case float64:
+		return v + s.N
+	case int:
+		return float64(v) + s.N
+	case int64:
+		// the Firestore Go client decodes integer fields as int64.
+		return v + int64(s.N)
+	case int32:
+		return int64(v) + int64(s.N)
+	default:
+		return s.N
+	}
+}
+
+// fieldDeleteSentinel mirrors firestore.Delete.
+type fieldDeleteSentinel struct{}
+
+func (fieldDeleteSentinel) tag() string   { return "delete" }
+func (fieldDeleteSentinel) apply(any) any { return nil }
+
+// FieldDelete is the sentinel value marking a field for removal.
+var FieldDelete Sentinel = fieldDeleteSentinel{}
+
+// serializeSentinel renders a Sentinel as the tagged object tagSentinels
+// writes in place of the value before a plain json.Marshal.
+func serializeSentinel(s Sentinel) map[string]any {
+	out := map[string]any{sentinelTagKey: s.tag()}
+	switch v := s.(type) {
+	case ArrayUnionSentinel:
+		out[sentinelValueKey] = []any(v)
+	case ArrayRemoveSentinel:
+		out[sentinelValueKey] = []any(v)
+	case IncrementSentinel:
+		out[sentinelValueKey] = v.N
+	}
+	return out
+}
+
+// deserializeSentinel recognizes the tagged object shape serializeSentinel
+// produced and reconstructs the concrete Sentinel, returning ok=false for any
+// other map.
+func deserializeSentinel(m map[string]any) (Sentinel, bool) {
+	tag, _ := m[sentinelTagKey].(string)
+	switch tag {
+	case "serverTimestamp":
+		return ServerTimestampSentinel{}, true
+	case "arrayUnion":
+		vals, _ := m[sentinelValueKey].([]any)
+		return ArrayUnionSentinel(vals), true
+	case "arrayRemove":
+		vals, _ := m[sentinelValueKey].([]any)
+		return ArrayRemoveSentinel(vals), true
+	case "increment":
+		n, _ := m[sentinelValueKey].(float64)
+		return IncrementSentinel{N: n}, true
+	case "delete":
+		return FieldDelete, true
+	default:
+		return nil, false
+	}
+}
+
+// tagSentinels returns a copy of data with every Sentinel value replaced by
+// its serializeSentinel tagged-object form, so it survives a plain
+// json.Marshal (e.g. into the journal) without losing its identity.
+func tagSentinels(data map[string]any) map[string]any {
+	if data == nil {
+		return nil
+	}
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		if s, ok := v.(Sentinel); ok {
+			out[k] = serializeSentinel(s)
+			continue
+		}
+		if nested, ok := v.(map[string]any); ok {
+			out[k] = tagSentinels(nested)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// untagSentinels reverses tagSentinels: any value holding the tagged-object
+// shape serializeSentinel produced (typically after a json.Unmarshal into
+// map[string]any) is reconstructed into its concrete Sentinel via
+// deserializeSentinel.
+func untagSentinels(data map[string]any) map[string]any {
+	if data == nil {
+		return nil
+	}
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		if m, ok := v.(map[string]any); ok {
+			if s, ok := deserializeSentinel(m); ok {
+				out[k] = s
+				continue
+			}
+			out[k] = untagSentinels(m)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// translateSentinels walks data and replaces any Sentinel value - however
+// deeply nested - with whatever representation database.EncodeSentinel
+// produces, so pushChange never writes the sentinel literal to the document.
+func translateSentinels(data map[string]any, database Firestore) map[string]any {
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		if s, ok := v.(Sentinel); ok {
+			out[k] = database.EncodeSentinel(s)
+			continue
+		}
+		if nested, ok := v.(map[string]any); ok {
+			out[k] = translateSentinels(nested, database)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// resolvePatchSentinels resolves any Sentinel fields in patch against their
+// current value in before, returning a plain map with no Sentinel values -
+// this is what a patch's after looks like once the transform has run.
+func resolvePatchSentinels(patch, before map[string]any) map[string]any {
+	after := make(map[string]any, len(patch))
+	for k, v := range patch {
+		if nested, ok := v.(map[string]any); ok {
+			nestedBefore, _ := before[k].(map[string]any)
+			after[k] = resolvePatchSentinels(nested, nestedBefore)
+			continue
+		}
+		s, ok := v.(Sentinel)
+		if !ok {
+			after[k] = v
+			continue
+		}
+		if _, isDelete := s.(fieldDeleteSentinel); isDelete {
+			continue
+		}
+		after[k] = s.apply(before[k])
+	}
+	return after
+}
+
+// hasSentinel reports whether any top-level value of patch is a Sentinel;
+// Sentinels inside nested maps are not looked for.
+func hasSentinel(patch map[string]any) bool {
+	for _, v := range patch {
+		if _, ok := v.(Sentinel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applySentinels merges before with patch, resolving any Sentinel fields
+// against before and deleting any field marked with FieldDelete.
+func applySentinels(before, patch map[string]any) map[string]any {
+	after := make(map[string]any, len(before)+len(patch))
+	for k, v := range before {
+		after[k] = v
+	}
+	for k, v := range patch {
+		s, ok := v.(Sentinel)
+		if !ok {
+			after[k] = v
+			continue
+		}
+		if _, isDelete := s.(fieldDeleteSentinel); isDelete {
+			delete(after, k)
+			continue
+		}
+		after[k] = s.apply(before[k])
+	}
+	return after
+}
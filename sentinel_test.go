@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func TestIncrementSentinelApply(t *testing.T) {
+	cases := []struct {
+		name    string
+		current any
+		want    any
+	}{
+		{"float64", float64(10), float64(15)},
+		{"int", int(10), float64(15)},
+		{"int64", int64(10), int64(15)}, // the Firestore Go client decodes ints as int64
+		{"int32", int32(10), int64(15)},
+		{"missing", nil, float64(5)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := Increment(5).apply(c.current)
+			if got != c.want {
+				t.Errorf("Increment(5).apply(%v) = %v (%T), want %v (%T)", c.current, got, got, c.want, c.want)
+			}
+		})
+	}
+}
+
+func TestArrayUnionSentinelApply(t *testing.T) {
+	existing := []any{"a", "b"}
+	got := ArrayUnionSentinel{"b", "c"}.apply(existing).([]any)
+	if len(got) != 3 {
+		t.Fatalf("ArrayUnion: expected 3 elements, got %v", got)
+	}
+}
+
+func TestArrayRemoveSentinelApply(t *testing.T) {
+	existing := []any{"a", "b"}
+	got := ArrayRemoveSentinel{"a"}.apply(existing).([]any)
+	if len(got) != 1 || got[0] != "b" {
+		t.Fatalf("ArrayRemove: expected [b], got %v", got)
+	}
+}
+
+func TestTranslateSentinelsNested(t *testing.T) {
+	db := newFakeFirestore()
+	data := map[string]any{
+		"stats": map[string]any{
+			"views": Increment(1),
+		},
+	}
+
+	out := translateSentinels(data, db)
+
+	stats, ok := out["stats"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected nested stats map, got %T", out["stats"])
+	}
+	if _, stillSentinel := stats["views"].(Sentinel); stillSentinel {
+		t.Errorf("nested Sentinel was not translated via EncodeSentinel")
+	}
+	if len(db.encoded) != 1 {
+		t.Errorf("expected EncodeSentinel to be called once for the nested field, got %d", len(db.encoded))
+	}
+}
+
+func TestApplySentinelsDeletesField(t *testing.T) {
+	before := map[string]any{"name": "ada", "legacy": "x"}
+	patch := map[string]any{"legacy": FieldDelete}
+
+	after := applySentinels(before, patch)
+
+	if _, present := after["legacy"]; present {
+		t.Errorf("expected FieldDelete to remove the field")
+	}
+	if after["name"] != "ada" {
+		t.Errorf("expected untouched fields to survive, got %v", after["name"])
+	}
+}
+
+func TestSentinelTagUntagRoundTrip(t *testing.T) {
+	data := map[string]any{"views": Increment(3)}
+
+	tagged := tagSentinels(data)
+	viewsTag, ok := tagged["views"].(map[string]any)
+	if !ok || viewsTag[sentinelTagKey] != "increment" {
+		t.Fatalf("expected tagged increment object, got %v", tagged["views"])
+	}
+
+	untagged := untagSentinels(tagged)
+	s, ok := untagged["views"].(IncrementSentinel)
+	if !ok || s.N != 3 {
+		t.Fatalf("expected round trip back to IncrementSentinel{N: 3}, got %v", untagged["views"])
+	}
+}